@@ -2,14 +2,23 @@ package codec
 
 import (
 	"archive/tar"
+	"archive/zip"
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"os/exec"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -133,6 +142,107 @@ func TestAutoReader(t *testing.T) {
 	)
 }
 
+func TestAutoReaderJSON(t *testing.T) {
+	buf := noopCloser{bytes.NewReader([]byte(`[{"a":1},{"a":2}]`))}
+	testReaderOrdered(t, "auto", "foo.json", buf, `{"a":1}`, `{"a":2}`)
+
+	buf = noopCloser{bytes.NewReader([]byte("{\"a\":1}\n{\"a\":2}\n"))}
+	testReaderOrdered(t, "auto", "foo.ndjson", buf, `{"a":1}`, `{"a":2}`)
+
+	buf = noopCloser{bytes.NewReader([]byte("{\"a\":1}\n{\"a\":2}\n"))}
+	testReaderOrdered(t, "auto", "foo.jsonl", buf, `{"a":1}`, `{"a":2}`)
+}
+
+func TestAutoReaderCompressionExtensions(t *testing.T) {
+	var zstdBuf bytes.Buffer
+	zw, err := zstd.NewWriter(&zstdBuf)
+	require.NoError(t, err)
+	_, err = zw.Write([]byte("foo\nbar\nbaz"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	zstdBytes := zstdBuf.Bytes()
+
+	buf := noopCloser{bytes.NewReader(zstdBytes)}
+	testReaderOrdered(t, "auto", "foo.zst", buf, "foo", "bar", "baz")
+
+	buf = noopCloser{bytes.NewReader(zstdBytes)}
+	testReaderOrdered(t, "auto", "foo.zstd", buf, "foo", "bar", "baz")
+
+	bzip2Bytes := bzip2CompressForTest(t, []byte("foo\nbar\nbaz"))
+
+	buf = noopCloser{bytes.NewReader(bzip2Bytes)}
+	testReaderOrdered(t, "auto", "foo.bz2", buf, "foo", "bar", "baz")
+
+	input := []string{"first document", "second document", "third document"}
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for i := range input {
+		hdr := &tar.Header{
+			Name: fmt.Sprintf("testfile%v", i),
+			Mode: 0600,
+			Size: int64(len(input[i])),
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write([]byte(input[i]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	var tgzBuf bytes.Buffer
+	gzw := gzip.NewWriter(&tgzBuf)
+	_, err = gzw.Write(tarBuf.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, gzw.Close())
+
+	buf = noopCloser{bytes.NewReader(tgzBuf.Bytes())}
+	testReaderOrdered(t, "auto", "foo.tgz", buf, input...)
+
+	tbz2Bytes := bzip2CompressForTest(t, tarBuf.Bytes())
+
+	buf = noopCloser{bytes.NewReader(tbz2Bytes)}
+	testReaderOrdered(t, "auto", "foo.tbz2", buf, input...)
+}
+
+func TestJSONArrayReader(t *testing.T) {
+	buf := noopCloser{bytes.NewReader([]byte(`[{"a":1},{"a":2},{"a":3}]`))}
+	testReaderOrdered(t, "json-array", "", buf, `{"a":1}`, `{"a":2}`, `{"a":3}`)
+
+	buf = noopCloser{bytes.NewReader([]byte(`[{"a":1},{"a":2},{"a":3}]`))}
+	testReaderUnordered(t, "json-array", "", buf, `{"a":1}`, `{"a":2}`, `{"a":3}`)
+}
+
+func TestJSONArrayReaderEmpty(t *testing.T) {
+	buf := noopCloser{bytes.NewReader([]byte(`[]`))}
+	ctor, err := GetReader("json-array", NewReaderConfig())
+	require.NoError(t, err)
+
+	r, err := ctor("", buf, func(ctx context.Context, err error) error { return nil })
+	require.NoError(t, err)
+
+	_, _, err = r.Next(context.Background())
+	assert.EqualError(t, err, "EOF")
+	assert.NoError(t, r.Close(context.Background()))
+}
+
+func TestJSONStreamReader(t *testing.T) {
+	buf := noopCloser{bytes.NewReader([]byte("{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n"))}
+	testReaderOrdered(t, "json-stream", "", buf, `{"a":1}`, `{"a":2}`, `{"a":3}`)
+
+	buf = noopCloser{bytes.NewReader([]byte(`{"a":1} {"a":2} {"a":3}`))}
+	testReaderUnordered(t, "json-stream", "", buf, `{"a":1}`, `{"a":2}`, `{"a":3}`)
+}
+
+func TestJSONStreamGzipReader(t *testing.T) {
+	var gzipBuf bytes.Buffer
+	zw := gzip.NewWriter(&gzipBuf)
+	zw.Write([]byte("{\"a\":1}\n{\"a\":2}\n"))
+	zw.Close()
+
+	buf := noopCloser{bytes.NewReader(gzipBuf.Bytes())}
+	testReaderOrdered(t, "json-stream-gzip", "", buf, `{"a":1}`, `{"a":2}`)
+}
+
 func TestCSVGzipReader(t *testing.T) {
 	var gzipBuf bytes.Buffer
 	zw := gzip.NewWriter(&gzipBuf)
@@ -172,6 +282,51 @@ func TestDelimReader(t *testing.T) {
 	testReaderUnordered(t, "delim:X", "", buf, "foo", "bar", "baz")
 }
 
+func TestRegexReader(t *testing.T) {
+	input := "2020-01-01 first line\nmore of first\n2020-01-02 second line\n2020-01-03 third line\nmore of third\n"
+	expected := []string{
+		"2020-01-01 first line\nmore of first\n",
+		"2020-01-02 second line\n",
+		"2020-01-03 third line\nmore of third\n",
+	}
+
+	buf := noopCloser{bytes.NewReader([]byte(input))}
+	testReaderOrdered(t, `regex:^\d{4}-\d{2}-\d{2}`, "", buf, expected...)
+
+	buf = noopCloser{bytes.NewReader([]byte(input))}
+	testReaderUnordered(t, `regex:^\d{4}-\d{2}-\d{2}`, "", buf, expected...)
+}
+
+func TestRegexReaderEmptyPattern(t *testing.T) {
+	_, err := GetReader("regex:", NewReaderConfig())
+	assert.Error(t, err)
+}
+
+func TestRegexReaderMultiByteRune(t *testing.T) {
+	input := "→first record→second record→third record"
+	expected := []string{"→first record", "→second record", "→third record"}
+
+	buf := noopCloser{bytes.NewReader([]byte(input))}
+	testReaderOrdered(t, "regex:→", "", buf, expected...)
+}
+
+func TestRegexReaderLargeRecord(t *testing.T) {
+	first := strings.Repeat("a", bufio.MaxScanTokenSize+1024)
+	second := "tail record"
+	input := "START" + first + "START" + second
+
+	conf := NewReaderConfig()
+	conf.MaxScanTokenSize = len(first) + 1024
+
+	ctor, err := GetReader("regex:START", conf)
+	require.NoError(t, err)
+
+	r, err := ctor("", noopCloser{bytes.NewReader([]byte(input))}, func(ctx context.Context, err error) error { return nil })
+	require.NoError(t, err)
+
+	testReaderOrderedFromReader(t, r, "START"+first, "START"+second)
+}
+
 func TestTarReader(t *testing.T) {
 	input := []string{
 		"first document",
@@ -205,6 +360,78 @@ func TestTarReader(t *testing.T) {
 	testReaderUnordered(t, "tar", "", buf, input...)
 }
 
+func TestZipReader(t *testing.T) {
+	input := []string{
+		"first document",
+		"second document",
+		"third document",
+	}
+
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	for i := range input {
+		w, err := zw.Create(fmt.Sprintf("testfile%v", i))
+		require.NoError(t, err)
+
+		_, err = w.Write([]byte(input[i]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	inputBytes := zipBuf.Bytes()
+
+	buf := noopCloser{bytes.NewReader(inputBytes)}
+	testReaderOrdered(t, "zip", "", buf, input...)
+
+	buf = noopCloser{bytes.NewReader(inputBytes)}
+	testReaderUnordered(t, "zip", "", buf, input...)
+}
+
+func TestZipReaderMetadata(t *testing.T) {
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	w, err := zw.Create("dir/testfile")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	ctor, err := GetReader("zip", NewReaderConfig())
+	require.NoError(t, err)
+
+	r, err := ctor("", noopCloser{bytes.NewReader(zipBuf.Bytes())}, func(ctx context.Context, err error) error {
+		return nil
+	})
+	require.NoError(t, err)
+
+	p, ackFn, err := r.Next(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, ackFn(context.Background(), nil))
+
+	assert.Equal(t, "hello world", string(p.Get()))
+	assert.Equal(t, "dir/testfile", p.Metadata().Get("path"))
+	assert.NotEmpty(t, p.Metadata().Get("size"))
+
+	_, _, err = r.Next(context.Background())
+	assert.EqualError(t, err, "EOF")
+	assert.NoError(t, r.Close(context.Background()))
+}
+
+func TestZipReaderSkipsDirectories(t *testing.T) {
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	_, err := zw.Create("dir/")
+	require.NoError(t, err)
+	w, err := zw.Create("dir/testfile")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	buf := noopCloser{bytes.NewReader(zipBuf.Bytes())}
+	testReaderOrdered(t, "zip", "", buf, "hello world")
+}
+
 func TestTarGzipReader(t *testing.T) {
 	input := []string{
 		"first document",
@@ -240,3 +467,443 @@ func TestTarGzipReader(t *testing.T) {
 	buf = noopCloser{bytes.NewReader(inputBytes)}
 	testReaderUnordered(t, "tar-gzip", "", buf, input...)
 }
+
+func TestCSVZstdReader(t *testing.T) {
+	var zstdBuf bytes.Buffer
+	zw, err := zstd.NewWriter(&zstdBuf)
+	require.NoError(t, err)
+	_, err = zw.Write([]byte("col1,col2,col3\nfoo1,bar1,baz1\nfoo2,bar2,baz2\nfoo3,bar3,baz3"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	inputBytes := zstdBuf.Bytes()
+
+	buf := noopCloser{bytes.NewReader(inputBytes)}
+	testReaderOrdered(
+		t, "csv-zstd", "", buf,
+		`{"col1":"foo1","col2":"bar1","col3":"baz1"}`,
+		`{"col1":"foo2","col2":"bar2","col3":"baz2"}`,
+		`{"col1":"foo3","col2":"bar3","col3":"baz3"}`,
+	)
+
+	buf = noopCloser{bytes.NewReader(inputBytes)}
+	testReaderUnordered(
+		t, "csv-zstd", "", buf,
+		`{"col1":"foo1","col2":"bar1","col3":"baz1"}`,
+		`{"col1":"foo2","col2":"bar2","col3":"baz2"}`,
+		`{"col1":"foo3","col2":"bar3","col3":"baz3"}`,
+	)
+}
+
+func TestTarZstdReader(t *testing.T) {
+	input := []string{
+		"first document",
+		"second document",
+		"third document",
+	}
+
+	var zstdBuf bytes.Buffer
+	zw, err := zstd.NewWriter(&zstdBuf)
+	require.NoError(t, err)
+	tw := tar.NewWriter(zw)
+	for i := range input {
+		hdr := &tar.Header{
+			Name: fmt.Sprintf("testfile%v", i),
+			Mode: 0600,
+			Size: int64(len(input[i])),
+		}
+
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err = tw.Write([]byte(input[i]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+
+	inputBytes := zstdBuf.Bytes()
+
+	buf := noopCloser{bytes.NewReader(inputBytes)}
+	testReaderOrdered(t, "tar-zstd", "", buf, input...)
+
+	buf = noopCloser{bytes.NewReader(inputBytes)}
+	testReaderUnordered(t, "tar-zstd", "", buf, input...)
+}
+
+func TestLinesBzip2Reader(t *testing.T) {
+	// compress/bzip2 only ships a reader, so these fixtures were produced
+	// with the standard `bzip2` CLI over "foo\nbar\nbaz".
+	inputBytes := bzip2CompressForTest(t, []byte("foo\nbar\nbaz"))
+
+	buf := noopCloser{bytes.NewReader(inputBytes)}
+	testReaderOrdered(t, "lines-bzip2", "", buf, "foo", "bar", "baz")
+
+	buf = noopCloser{bytes.NewReader(inputBytes)}
+	testReaderUnordered(t, "lines-bzip2", "", buf, "foo", "bar", "baz")
+}
+
+func TestTarBzip2Reader(t *testing.T) {
+	input := []string{
+		"first document",
+		"second document",
+		"third document",
+	}
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for i := range input {
+		hdr := &tar.Header{
+			Name: fmt.Sprintf("testfile%v", i),
+			Mode: 0600,
+			Size: int64(len(input[i])),
+		}
+
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write([]byte(input[i]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	inputBytes := bzip2CompressForTest(t, tarBuf.Bytes())
+
+	buf := noopCloser{bytes.NewReader(inputBytes)}
+	testReaderOrdered(t, "tar-bzip2", "", buf, input...)
+
+	buf = noopCloser{bytes.NewReader(inputBytes)}
+	testReaderUnordered(t, "tar-bzip2", "", buf, input...)
+}
+
+// bzip2CompressForTest shells out to the bzip2 CLI to produce a fixture,
+// since the standard library only implements a bzip2 reader.
+func bzip2CompressForTest(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	cmd := exec.Command("bzip2", "-z", "-c")
+	cmd.Stdin = bytes.NewReader(data)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+
+	if err := cmd.Run(); err != nil {
+		t.Skipf("bzip2 CLI not available to build test fixture: %v", err)
+	}
+	return out.Bytes()
+}
+
+// seekableReadCloser is an io.ReadCloser that also implements io.Seeker, for
+// exercising the codecs that need random access to resume from an offset.
+type seekableReadCloser struct {
+	*bytes.Reader
+}
+
+func (seekableReadCloser) Close() error { return nil }
+
+func TestLinesReaderOffset(t *testing.T) {
+	data := []byte("foo\nbar\nbaz")
+
+	ctor, err := GetReader("lines", NewReaderConfig())
+	require.NoError(t, err)
+
+	r, err := ctor("", noopCloser{bytes.NewReader(data)}, func(ctx context.Context, err error) error { return nil })
+	require.NoError(t, err)
+
+	p, ackFn, err := r.Next(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, ackFn(context.Background(), nil))
+	assert.Equal(t, "foo", string(p.Get()))
+	require.NoError(t, r.Close(context.Background()))
+
+	offset, err := strconv.ParseInt(p.Metadata().Get(CodecOffsetMetaKey), 10, 64)
+	require.NoError(t, err)
+
+	r2, err := ctor("", noopCloser{bytes.NewReader(data)}, func(ctx context.Context, err error) error { return nil }, offset)
+	require.NoError(t, err)
+	testReaderOrderedFromReader(t, r2, "bar", "baz")
+}
+
+func TestAllBytesReaderOffset(t *testing.T) {
+	data := []byte("foobarbaz")
+
+	ctor, err := GetReader("all-bytes", NewReaderConfig())
+	require.NoError(t, err)
+
+	r, err := ctor("", noopCloser{bytes.NewReader(data)}, func(ctx context.Context, err error) error { return nil }, int64(3))
+	require.NoError(t, err)
+	testReaderOrderedFromReader(t, r, "barbaz")
+}
+
+func TestTarReaderOffset(t *testing.T) {
+	input := []string{
+		"first document",
+		"second document",
+		"third document",
+	}
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for i := range input {
+		hdr := &tar.Header{
+			Name: fmt.Sprintf("testfile%v", i),
+			Mode: 0600,
+			Size: int64(len(input[i])),
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write([]byte(input[i]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	data := tarBuf.Bytes()
+
+	ctor, err := GetReader("tar", NewReaderConfig())
+	require.NoError(t, err)
+
+	r, err := ctor("", noopCloser{bytes.NewReader(data)}, func(ctx context.Context, err error) error { return nil })
+	require.NoError(t, err)
+
+	p, ackFn, err := r.Next(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, ackFn(context.Background(), nil))
+	assert.Equal(t, input[0], string(p.Get()))
+	require.NoError(t, r.Close(context.Background()))
+
+	offset, err := strconv.ParseInt(p.Metadata().Get(CodecOffsetMetaKey), 10, 64)
+	require.NoError(t, err)
+
+	r2, err := ctor("", noopCloser{bytes.NewReader(data)}, func(ctx context.Context, err error) error { return nil }, offset)
+	require.NoError(t, err)
+	testReaderOrderedFromReader(t, r2, input[1], input[2])
+}
+
+func TestCSVReaderOffset(t *testing.T) {
+	data := []byte("col1,col2,col3\nfoo1,bar1,baz1\nfoo2,bar2,baz2\nfoo3,bar3,baz3")
+
+	ctor, err := GetReader("csv", NewReaderConfig())
+	require.NoError(t, err)
+
+	r, err := ctor("", seekableReadCloser{bytes.NewReader(data)}, func(ctx context.Context, err error) error { return nil })
+	require.NoError(t, err)
+
+	p, ackFn, err := r.Next(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, ackFn(context.Background(), nil))
+	assert.Equal(t, `{"col1":"foo1","col2":"bar1","col3":"baz1"}`, string(p.Get()))
+	require.NoError(t, r.Close(context.Background()))
+
+	offset, err := strconv.ParseInt(p.Metadata().Get(CodecOffsetMetaKey), 10, 64)
+	require.NoError(t, err)
+
+	r2, err := ctor("", seekableReadCloser{bytes.NewReader(data)}, func(ctx context.Context, err error) error { return nil }, offset)
+	require.NoError(t, err)
+	testReaderOrderedFromReader(
+		t, r2,
+		`{"col1":"foo2","col2":"bar2","col3":"baz2"}`,
+		`{"col1":"foo3","col2":"bar3","col3":"baz3"}`,
+	)
+}
+
+// testReaderOrderedFromReader drives an already-constructed Reader (used for
+// offset-resumed readers, which can't be created through the plain ctor call
+// that testReaderOrdered makes) and asserts it yields exactly the expected
+// messages, acking each one in order as it's read.
+func testReaderOrderedFromReader(t *testing.T, r Reader, expected ...string) {
+	t.Helper()
+
+	for _, exp := range expected {
+		p, ackFn, err := r.Next(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, ackFn(context.Background(), nil))
+		assert.Equal(t, exp, string(p.Get()))
+	}
+
+	_, _, err := r.Next(context.Background())
+	assert.EqualError(t, err, "EOF")
+	assert.NoError(t, r.Close(context.Background()))
+}
+
+// buildChunkedTarGzipArchive assembles an in-memory eStargz-style archive:
+// each input is stored as its own gzip member, followed by a gzipped JSON TOC
+// and the fixed-size footer pointing at it.
+func buildChunkedTarGzipArchive(t *testing.T, names []string, contents []string) []byte {
+	t.Helper()
+	require.Equal(t, len(names), len(contents))
+
+	var buf bytes.Buffer
+	toc := chunkedTarGzipTOC{}
+	for i, name := range names {
+		offset := int64(buf.Len())
+
+		gz := gzip.NewWriter(&buf)
+		_, err := gz.Write([]byte(contents[i]))
+		require.NoError(t, err)
+		require.NoError(t, gz.Close())
+
+		sum := sha256.Sum256([]byte(contents[i]))
+		toc.Entries = append(toc.Entries, chunkedTarGzipTOCEntry{
+			Name:      name,
+			Offset:    offset,
+			ChunkSize: int64(len(contents[i])),
+			Digest:    "sha256:" + hex.EncodeToString(sum[:]),
+		})
+	}
+
+	tocOffset := int64(buf.Len())
+	tocJSON, err := json.Marshal(toc)
+	require.NoError(t, err)
+
+	gz := gzip.NewWriter(&buf)
+	_, err = gz.Write(tocJSON)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	tocLen := int64(buf.Len()) - tocOffset
+
+	buf.Write(chunkedTarGzipFooterBytes(tocOffset, tocLen))
+
+	return buf.Bytes()
+}
+
+func TestChunkedTarGzipReader(t *testing.T) {
+	names := []string{"first", "second", "third"}
+	input := []string{"first document", "second document", "third document"}
+
+	archive := buildChunkedTarGzipArchive(t, names, input)
+
+	buf := noopCloser{bytes.NewReader(archive)}
+	testReaderOrdered(t, "chunked-tar-gzip", "", buf, input...)
+
+	buf = noopCloser{bytes.NewReader(archive)}
+	testReaderUnordered(t, "chunked-tar-gzip", "", buf, input...)
+}
+
+func TestChunkedTarGzipReaderMetadata(t *testing.T) {
+	names := []string{"dir/testfile"}
+	input := []string{"hello world"}
+
+	archive := buildChunkedTarGzipArchive(t, names, input)
+
+	ctor, err := GetReader("chunked-tar-gzip", NewReaderConfig())
+	require.NoError(t, err)
+
+	r, err := ctor("", noopCloser{bytes.NewReader(archive)}, func(ctx context.Context, err error) error {
+		return nil
+	})
+	require.NoError(t, err)
+
+	p, ackFn, err := r.Next(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, ackFn(context.Background(), nil))
+
+	assert.Equal(t, "hello world", string(p.Get()))
+	assert.Equal(t, "dir/testfile", p.Metadata().Get("path"))
+
+	_, _, err = r.Next(context.Background())
+	assert.EqualError(t, err, "EOF")
+	assert.NoError(t, r.Close(context.Background()))
+}
+
+func TestChunkedTarGzipReaderNextAt(t *testing.T) {
+	names := []string{"first", "second", "third"}
+	input := []string{"first document", "second document", "third document"}
+
+	archive := buildChunkedTarGzipArchive(t, names, input)
+
+	ctor, err := GetReader("chunked-tar-gzip", NewReaderConfig())
+	require.NoError(t, err)
+
+	r, err := ctor("", noopCloser{bytes.NewReader(archive)}, func(ctx context.Context, err error) error {
+		return nil
+	})
+	require.NoError(t, err)
+
+	randomAccess, ok := r.(RandomAccessReader)
+	require.True(t, ok, "chunked-tar-gzip reader should implement RandomAccessReader")
+
+	p, ackFn, err := randomAccess.NextAt(context.Background(), "third")
+	require.NoError(t, err)
+	require.NoError(t, ackFn(context.Background(), nil))
+	assert.Equal(t, input[2], string(p.Get()))
+
+	p, ackFn, err = randomAccess.NextAt(context.Background(), "first")
+	require.NoError(t, err)
+	require.NoError(t, ackFn(context.Background(), nil))
+	assert.Equal(t, input[0], string(p.Get()))
+
+	_, _, err = randomAccess.NextAt(context.Background(), "missing")
+	assert.Error(t, err)
+
+	require.NoError(t, r.Close(context.Background()))
+}
+
+func TestChunkedTarGzipReaderInvalidChunkSize(t *testing.T) {
+	archive := buildChunkedTarGzipArchive(t, []string{"first"}, []string{"first document"})
+
+	var toc chunkedTarGzipTOC
+	tocOffset, tocLen, err := parseChunkedTarGzipFooter(archive[len(archive)-chunkedTarGzipFooterSize:])
+	require.NoError(t, err)
+	gz, err := gzip.NewReader(bytes.NewReader(archive[tocOffset : tocOffset+tocLen]))
+	require.NoError(t, err)
+	require.NoError(t, json.NewDecoder(gz).Decode(&toc))
+	toc.Entries[0].ChunkSize = -1
+
+	tocJSON, err := json.Marshal(toc)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	buf.Write(archive[:tocOffset])
+	gzw := gzip.NewWriter(&buf)
+	_, err = gzw.Write(tocJSON)
+	require.NoError(t, err)
+	require.NoError(t, gzw.Close())
+	newTocLen := int64(buf.Len()) - tocOffset
+	buf.Write(chunkedTarGzipFooterBytes(tocOffset, newTocLen))
+
+	ctor, err := GetReader("chunked-tar-gzip", NewReaderConfig())
+	require.NoError(t, err)
+
+	r, err := ctor("", noopCloser{bytes.NewReader(buf.Bytes())}, func(ctx context.Context, err error) error {
+		return nil
+	})
+	require.NoError(t, err)
+
+	_, _, err = r.Next(context.Background())
+	assert.Error(t, err)
+}
+
+// TestChunkedTarGzipReaderOverstatedChunkSize covers a TOC entry whose
+// ChunkSize claims more bytes than the entry's own gzip member actually
+// contains. Without Multistream(false) this would silently read on into the
+// next concatenated gzip member (here, the "second" entry) rather than
+// erroring.
+func TestChunkedTarGzipReaderOverstatedChunkSize(t *testing.T) {
+	archive := buildChunkedTarGzipArchive(t, []string{"first", "second"}, []string{"AAAA", "BBBB"})
+
+	var toc chunkedTarGzipTOC
+	tocOffset, tocLen, err := parseChunkedTarGzipFooter(archive[len(archive)-chunkedTarGzipFooterSize:])
+	require.NoError(t, err)
+	gz, err := gzip.NewReader(bytes.NewReader(archive[tocOffset : tocOffset+tocLen]))
+	require.NoError(t, err)
+	require.NoError(t, json.NewDecoder(gz).Decode(&toc))
+	toc.Entries[0].ChunkSize = 8
+	toc.Entries[0].Digest = ""
+
+	tocJSON, err := json.Marshal(toc)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	buf.Write(archive[:tocOffset])
+	gzw := gzip.NewWriter(&buf)
+	_, err = gzw.Write(tocJSON)
+	require.NoError(t, err)
+	require.NoError(t, gzw.Close())
+	newTocLen := int64(buf.Len()) - tocOffset
+	buf.Write(chunkedTarGzipFooterBytes(tocOffset, newTocLen))
+
+	ctor, err := GetReader("chunked-tar-gzip", NewReaderConfig())
+	require.NoError(t, err)
+
+	r, err := ctor("", noopCloser{bytes.NewReader(buf.Bytes())}, func(ctx context.Context, err error) error {
+		return nil
+	})
+	require.NoError(t, err)
+
+	_, _, err = r.Next(context.Background())
+	assert.Error(t, err)
+}